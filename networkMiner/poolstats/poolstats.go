@@ -0,0 +1,406 @@
+// Package poolstats implements an ethstats-style telemetry reporter for the
+// networkMiner MiningServer. It dials an external dashboard over a
+// websocket, performs a "hello" login handshake, and then pushes periodic
+// JSON frames describing pool health. Frames follow the emit-topic
+// convention used by eth-netstats, i.e. {"emit": ["topic", payload]}, so any
+// ethstats-compatible viewer can render them without modification.
+//
+// Topics emitted:
+//
+//   - "hello": sent once right after connecting. Carries the node name,
+//     protocol, network, and pool version so the dashboard can identify us.
+//   - "stats": emitted on a timer. Carries active/connected miner counts,
+//     the pool's total hashrate (summed from mining.GroupMinerStats), the
+//     coordinator's EC balance, and its uptime.
+//   - "miners": emitted alongside every "stats" frame. Carries one entry per
+//     connected TCPClient (id and its AddTag-reported tags, e.g. rig name)
+//     so the dashboard can render a per-miner list, not just pool totals.
+//   - "block": queued for each new common.MonitorEvent the coordinator
+//     forwards to its miners. Carries the directory block height and
+//     minute.
+//   - "pending": queued whenever a constructed OPR is distributed to
+//     clients.
+//   - "latency": queued for each Ping/Pong round trip measured with a
+//     client.
+//
+// A queued "block", "pending" or "latency" value that has not been sent yet
+// is replaced by the next one of the same topic, so during a burst only the
+// latest value of each topic is emitted.
+//
+// Reporter never blocks its callers: updates are coalesced into a
+// single-slot mailbox per topic, so a slow or wedged dashboard connection
+// cannot back-pressure ForwardMonitorEvents. If the dashboard connection
+// drops, Reporter reconnects with an exponential backoff.
+package poolstats
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/gorilla/websocket"
+	"github.com/pegnet/pegnet/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// statsInterval is how often a "stats" frame is emitted, modeled on
+// eth-netstats' default client reporting interval.
+const statsInterval = 5 * time.Second
+
+// Info is the static identity a Reporter announces during the "hello"
+// handshake.
+type Info struct {
+	Network         string
+	ProtocolVersion string
+	PoolVersion     string
+}
+
+// StatsSnapshot is the point-in-time pool state sampled for each periodic
+// "stats"/"miners" frame pair.
+type StatsSnapshot struct {
+	ActiveMiners    int
+	ConnectedMiners int
+	Hashrate        float64
+	ECBalance       uint64
+	Uptime          time.Duration
+
+	// Miners is the per-client detail sent in the "miners" frame.
+	Miners []MinerSnapshot
+}
+
+// MinerSnapshot is one client's id and AddTag tags.
+type MinerSnapshot struct {
+	ID   string
+	Tags map[string]string
+}
+
+// StatsProvider is called once per statsInterval to fetch the latest
+// StatsSnapshot to emit.
+type StatsProvider func() StatsSnapshot
+
+// Report is the transport a Reporter writes frames to. The production
+// implementation dials a websocket; tests can substitute a fake to assert on
+// emitted frames without a network.
+type Report interface {
+	WriteJSON(v interface{}) error
+	Close() error
+}
+
+// dialFunc is overridden in tests to avoid a real network dial.
+type dialFunc func(host string) (Report, error)
+
+// Reporter pushes pool telemetry to an ethstats-style dashboard. It is safe
+// for concurrent use; Push* methods may be called from any goroutine.
+type Reporter struct {
+	nodeName string
+	secret   string
+	host     string
+	info     Info
+
+	provider StatsProvider
+	dial     dialFunc
+
+	block   *mailbox
+	pending *mailbox
+	latency *mailbox
+
+	quit chan struct{}
+	once sync.Once
+}
+
+// NewReporter parses a dashboard URL of the form "nodename:secret@host:port"
+// and returns a Reporter ready to Run. provider is polled on a timer to
+// build outgoing "stats" frames.
+func NewReporter(rawURL string, info Info, provider StatsProvider) (*Reporter, error) {
+	nodeName, secret, host, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reporter{
+		nodeName: nodeName,
+		secret:   secret,
+		host:     host,
+		info:     info,
+		provider: provider,
+		dial:     dialWebsocket,
+		block:    newMailbox(),
+		pending:  newMailbox(),
+		latency:  newMailbox(),
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// parseURL splits "nodename:secret@host:port" into its parts.
+func parseURL(rawURL string) (nodeName, secret, host string, err error) {
+	at := strings.LastIndex(rawURL, "@")
+	if at < 0 {
+		return "", "", "", fmt.Errorf("poolstats: malformed dashboard url, expected nodename:secret@host:port")
+	}
+	host = rawURL[at+1:]
+
+	cred := rawURL[:at]
+	colon := strings.Index(cred, ":")
+	if colon < 0 {
+		return "", "", "", fmt.Errorf("poolstats: malformed dashboard url, missing secret")
+	}
+	nodeName, secret = cred[:colon], cred[colon+1:]
+
+	if nodeName == "" || host == "" {
+		return "", "", "", fmt.Errorf("poolstats: malformed dashboard url, expected nodename:secret@host:port")
+	}
+	return nodeName, secret, host, nil
+}
+
+// Stop tears down the Reporter and stops its reconnect loop.
+func (r *Reporter) Stop() {
+	r.once.Do(func() { close(r.quit) })
+}
+
+// PushBlock queues a "block" frame for the given directory block event.
+// Callers are never blocked: if a block is already queued and unsent, it is
+// replaced.
+func (r *Reporter) PushBlock(height, minute int64) {
+	r.block.Push(blockPayload{Height: height, Minute: minute})
+}
+
+// PushPending queues a "pending" frame describing an OPR that was just
+// distributed to clients.
+func (r *Reporter) PushPending(opr interface{}) {
+	r.pending.Push(opr)
+}
+
+// PushLatency queues a "latency" frame measured from a Ping/Pong round trip.
+func (r *Reporter) PushLatency(d time.Duration) {
+	r.latency.Push(int64(d / time.Millisecond))
+}
+
+// Run dials the dashboard and serves frames until Stop is called, retrying
+// with an exponential backoff whenever the connection is lost.
+func (r *Reporter) Run() {
+	boff := common.PegExponentialBackOff()
+	rLog := log.WithFields(log.Fields{"func": "poolstats.Run", "host": r.host})
+
+	for {
+		select {
+		case <-r.quit:
+			return
+		default:
+		}
+
+		conn, err := r.dial(r.host)
+		if err != nil {
+			d := boff.NextBackOff()
+			if d == backoff.Stop {
+				boff.Reset()
+				d = boff.NextBackOff()
+			}
+			rLog.WithError(err).Warn("dashboard dial failed, retrying")
+
+			select {
+			case <-time.After(d):
+				continue
+			case <-r.quit:
+				return
+			}
+		}
+
+		if err := r.hello(conn); err != nil {
+			rLog.WithError(err).Warn("dashboard handshake failed")
+			conn.Close()
+			continue
+		}
+		boff.Reset()
+
+		r.serve(conn, rLog)
+	}
+}
+
+// hello performs the login handshake: a single "hello" frame carrying the
+// node's name, secret, protocol, network, and pool version.
+func (r *Reporter) hello(conn Report) error {
+	return conn.WriteJSON(emitFrame{Emit: []interface{}{"hello", helloPayload{
+		ID: r.nodeName,
+		Info: nodeInfo{
+			Name:        r.nodeName,
+			Network:     r.info.Network,
+			Protocol:    r.info.ProtocolVersion,
+			PoolVersion: r.info.PoolVersion,
+		},
+		Secret: r.secret,
+	}}})
+}
+
+// serve drains coalesced updates and the stats ticker, writing a frame for
+// each one, until the connection errors out (triggering a reconnect).
+func (r *Reporter) serve(conn Report, rLog *log.Entry) {
+	defer conn.Close()
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+			if r.provider == nil {
+				continue
+			}
+			s := r.provider()
+			if err := conn.WriteJSON(emitFrame{Emit: []interface{}{"stats", statsPayload{
+				ID: r.nodeName,
+				Stats: stats{
+					Active:    s.ActiveMiners,
+					Connected: s.ConnectedMiners,
+					Hashrate:  s.Hashrate,
+					ECBalance: s.ECBalance,
+					Uptime:    s.Uptime.Seconds(),
+				},
+			}}}); err != nil {
+				rLog.WithError(err).Warn("failed to send stats frame")
+				return
+			}
+			if err := conn.WriteJSON(emitFrame{Emit: []interface{}{"miners", minersPayload{
+				ID:     r.nodeName,
+				Miners: toMinerPayloads(s.Miners),
+			}}}); err != nil {
+				rLog.WithError(err).Warn("failed to send miners frame")
+				return
+			}
+		case v, ok := <-r.block.C():
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(emitFrame{Emit: []interface{}{"block", v}}); err != nil {
+				rLog.WithError(err).Warn("failed to send block frame")
+				return
+			}
+		case v, ok := <-r.pending.C():
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(emitFrame{Emit: []interface{}{"pending", v}}); err != nil {
+				rLog.WithError(err).Warn("failed to send pending frame")
+				return
+			}
+		case v, ok := <-r.latency.C():
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(emitFrame{Emit: []interface{}{"latency", latencyPayload{Latency: v.(int64)}}}); err != nil {
+				rLog.WithError(err).Warn("failed to send latency frame")
+				return
+			}
+		}
+	}
+}
+
+// emitFrame is the ethstats emit-topic envelope: {"emit": ["topic", ...]}.
+type emitFrame struct {
+	Emit []interface{} `json:"emit"`
+}
+
+type helloPayload struct {
+	ID     string   `json:"id"`
+	Info   nodeInfo `json:"info"`
+	Secret string   `json:"secret"`
+}
+
+type nodeInfo struct {
+	Name        string `json:"name"`
+	Network     string `json:"net"`
+	Protocol    string `json:"protocol"`
+	PoolVersion string `json:"poolVersion"`
+}
+
+type statsPayload struct {
+	ID    string `json:"id"`
+	Stats stats  `json:"stats"`
+}
+
+type stats struct {
+	Active    int     `json:"active"`
+	Connected int     `json:"connected"`
+	Hashrate  float64 `json:"hashrate"`
+	ECBalance uint64  `json:"ecBalance"`
+	Uptime    float64 `json:"uptime"`
+}
+
+type minersPayload struct {
+	ID     string         `json:"id"`
+	Miners []minerPayload `json:"miners"`
+}
+
+type minerPayload struct {
+	ID   string            `json:"id"`
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+func toMinerPayloads(miners []MinerSnapshot) []minerPayload {
+	out := make([]minerPayload, len(miners))
+	for i, m := range miners {
+		out[i] = minerPayload{ID: m.ID, Tags: m.Tags}
+	}
+	return out
+}
+
+type blockPayload struct {
+	Height int64 `json:"height"`
+	Minute int64 `json:"minute"`
+}
+
+type latencyPayload struct {
+	Latency int64 `json:"latency"`
+}
+
+// mailbox is a single-slot queue that holds only the most recently pushed
+// value, coalescing bursts of updates so callers are never blocked by a slow
+// consumer.
+type mailbox struct {
+	ch chan interface{}
+}
+
+func newMailbox() *mailbox {
+	return &mailbox{ch: make(chan interface{}, 1)}
+}
+
+// Push replaces any queued-but-unsent value with v.
+func (m *mailbox) Push(v interface{}) {
+	select {
+	case m.ch <- v:
+	default:
+		select {
+		case <-m.ch:
+		default:
+		}
+		select {
+		case m.ch <- v:
+		default:
+		}
+	}
+}
+
+func (m *mailbox) C() <-chan interface{} {
+	return m.ch
+}
+
+// dialWebsocket dials the dashboard's websocket endpoint, following the
+// eth-netstats convention of serving the feed at "/api".
+func dialWebsocket(host string) (Report, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	conn, _, err := dialer.Dial(fmt.Sprintf("ws://%s/api", host), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &wsReport{conn: conn}, nil
+}
+
+type wsReport struct {
+	conn *websocket.Conn
+}
+
+func (w *wsReport) WriteJSON(v interface{}) error { return w.conn.WriteJSON(v) }
+func (w *wsReport) Close() error                  { return w.conn.Close() }
@@ -0,0 +1,227 @@
+package poolstats
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseURL(t *testing.T) {
+	cases := []struct {
+		name     string
+		rawURL   string
+		wantNode string
+		wantSec  string
+		wantHost string
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			rawURL:   "miner1:s3cr3t@dash.example.com:3000",
+			wantNode: "miner1",
+			wantSec:  "s3cr3t",
+			wantHost: "dash.example.com:3000",
+		},
+		{
+			name:    "missing at",
+			rawURL:  "miner1:s3cr3t",
+			wantErr: true,
+		},
+		{
+			name:    "missing secret colon",
+			rawURL:  "miner1@dash.example.com:3000",
+			wantErr: true,
+		},
+		{
+			name:    "empty node name",
+			rawURL:  ":s3cr3t@dash.example.com:3000",
+			wantErr: true,
+		},
+		{
+			name:    "empty host",
+			rawURL:  "miner1:s3cr3t@",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			node, secret, host, err := parseURL(c.rawURL)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("parseURL(%q): expected error, got none", c.rawURL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseURL(%q): unexpected error: %v", c.rawURL, err)
+			}
+			if node != c.wantNode || secret != c.wantSec || host != c.wantHost {
+				t.Fatalf("parseURL(%q) = %q, %q, %q; want %q, %q, %q",
+					c.rawURL, node, secret, host, c.wantNode, c.wantSec, c.wantHost)
+			}
+		})
+	}
+}
+
+func TestMailboxCoalesces(t *testing.T) {
+	m := newMailbox()
+
+	m.Push(1)
+	m.Push(2)
+	m.Push(3)
+
+	select {
+	case v := <-m.C():
+		if v != 3 {
+			t.Fatalf("got %v, want latest pushed value 3", v)
+		}
+	default:
+		t.Fatal("expected a coalesced value to be ready")
+	}
+
+	select {
+	case v := <-m.C():
+		t.Fatalf("expected mailbox to be empty after drain, got %v", v)
+	default:
+	}
+}
+
+func TestMailboxPushNonBlocking(t *testing.T) {
+	m := newMailbox()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			m.Push(i)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Push blocked with no consumer draining the mailbox")
+	}
+}
+
+// fakeReport is a Report that records every frame written and can be made to
+// fail on demand, for exercising Reporter without a real network dial.
+type fakeReport struct {
+	writes    []interface{}
+	failWrite bool
+	closed    bool
+}
+
+func (f *fakeReport) WriteJSON(v interface{}) error {
+	if f.failWrite {
+		return errors.New("fake write failure")
+	}
+	f.writes = append(f.writes, v)
+	return nil
+}
+
+func (f *fakeReport) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestReporterHelloPayload(t *testing.T) {
+	r := &Reporter{
+		nodeName: "miner1",
+		secret:   "s3cr3t",
+		info: Info{
+			Network:         "testnet",
+			ProtocolVersion: "pegnet/1",
+			PoolVersion:     "1.0.0",
+		},
+	}
+
+	conn := &fakeReport{}
+	if err := r.hello(conn); err != nil {
+		t.Fatalf("hello: unexpected error: %v", err)
+	}
+	if len(conn.writes) != 1 {
+		t.Fatalf("hello: expected 1 frame written, got %d", len(conn.writes))
+	}
+
+	frame, ok := conn.writes[0].(emitFrame)
+	if !ok {
+		t.Fatalf("hello: wrote %T, want emitFrame", conn.writes[0])
+	}
+	if len(frame.Emit) != 2 || frame.Emit[0] != "hello" {
+		t.Fatalf("hello: emit = %#v, want [\"hello\", helloPayload]", frame.Emit)
+	}
+
+	payload, ok := frame.Emit[1].(helloPayload)
+	if !ok {
+		t.Fatalf("hello: payload is %T, want helloPayload", frame.Emit[1])
+	}
+	want := helloPayload{
+		ID: "miner1",
+		Info: nodeInfo{
+			Name:        "miner1",
+			Network:     "testnet",
+			Protocol:    "pegnet/1",
+			PoolVersion: "1.0.0",
+		},
+		Secret: "s3cr3t",
+	}
+	if payload != want {
+		t.Fatalf("hello payload = %#v, want %#v", payload, want)
+	}
+}
+
+func TestReporterRunReconnectsOnWriteError(t *testing.T) {
+	firstConn := &fakeReport{failWrite: true}
+	secondConn := &fakeReport{}
+
+	dialed := 0
+	dials := []Report{firstConn, secondConn}
+
+	r := &Reporter{
+		nodeName: "miner1",
+		secret:   "s3cr3t",
+		host:     "dash.example.com:3000",
+		block:    newMailbox(),
+		pending:  newMailbox(),
+		latency:  newMailbox(),
+		quit:     make(chan struct{}),
+		dial: func(host string) (Report, error) {
+			conn := dials[dialed]
+			dialed++
+			return conn, nil
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.Run()
+		close(done)
+	}()
+
+	// The first connection's hello write fails, forcing a reconnect onto the
+	// second connection, which succeeds. Once it has, stop the Reporter.
+	for i := 0; i < 1000 && !secondConn.closed; i++ {
+		if len(secondConn.writes) > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	r.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not exit after Stop")
+	}
+
+	if !firstConn.closed {
+		t.Fatal("expected the failing first connection to be closed")
+	}
+	if dialed < 2 {
+		t.Fatalf("expected Run to redial after a write error, only dialed %d time(s)", dialed)
+	}
+	if len(secondConn.writes) == 0 {
+		t.Fatal("expected the hello handshake to succeed on the second connection")
+	}
+}
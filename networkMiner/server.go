@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/FactomProject/factom"
 	"github.com/cenkalti/backoff"
 	"github.com/pegnet/pegnet/common"
 	"github.com/pegnet/pegnet/mining"
+	"github.com/pegnet/pegnet/networkMiner/poolstats"
 	"github.com/pegnet/pegnet/opr"
 	log "github.com/sirupsen/logrus"
 	"github.com/zpatrick/go-config"
@@ -28,6 +31,14 @@ const (
 	AddTag
 )
 
+const (
+	// WireProtocolVersion identifies the miner<->coordinator wire protocol
+	// to the pool telemetry dashboard.
+	WireProtocolVersion = "pegnet/1"
+	// PoolVersion is reported to the pool telemetry dashboard.
+	PoolVersion = "1.0.0"
+)
+
 // Idk why the factom.entry does not work
 type GobbedEntry struct {
 	ChainID string   `json:"chainid"`
@@ -63,8 +74,27 @@ type MiningServer struct {
 
 	Stats *mining.GlobalStatTracker
 
+	// Reporter pushes pool telemetry to an ethstats-style dashboard. It is
+	// nil unless a dashboard url was configured.
+	Reporter *poolstats.Reporter
+
+	startTime time.Time
+
+	// log is bound once in NewMiningServer with pool-wide fields (host, EC
+	// address prefix).
+	log *log.Entry
+	// clientCount mirrors len(clients), kept as an atomic so it can be read
+	// for logging without taking clientsLock.
+	clientCount int32
+
 	clientsLock sync.Mutex
 	clients     map[int]*TCPClient
+
+	statsLock        sync.Mutex
+	latestGroupStats map[int]mining.GroupMinerStats
+
+	pingLock sync.Mutex
+	pingSent map[int]time.Time
 }
 
 func NewMiningServer(config *config.Config, monitor common.IMonitor, grader opr.IGrader, stats *mining.GlobalStatTracker) *MiningServer {
@@ -73,6 +103,8 @@ func NewMiningServer(config *config.Config, monitor common.IMonitor, grader opr.
 	s.config = config
 
 	s.clients = make(map[int]*TCPClient)
+	s.latestGroupStats = make(map[int]mining.GroupMinerStats)
+	s.pingSent = make(map[int]time.Time)
 	s.FactomMonitor = monitor
 	s.OPRGrader = grader
 	s.Stats = stats
@@ -92,6 +124,29 @@ func NewMiningServer(config *config.Config, monitor common.IMonitor, grader opr.
 		s.EC = ecAdr
 	}
 
+	ecPrefix := s.EC.String()
+	if len(ecPrefix) > 8 {
+		ecPrefix = ecPrefix[:8]
+	}
+	s.log = log.WithFields(log.Fields{"host": s.Host, "ec": ecPrefix})
+
+	// The dashboard url is optional; a coordinator with none configured
+	// simply never reports telemetry.
+	if dashURL, err := config.String("Miner.EthstatsURL"); err == nil && dashURL != "" {
+		network, _ := config.String(common.ConfigPegnetNetwork)
+		info := poolstats.Info{
+			Network:         network,
+			ProtocolVersion: WireProtocolVersion,
+			PoolVersion:     PoolVersion,
+		}
+		reporter, err := poolstats.NewReporter(dashURL, info, s.statsSnapshot)
+		if err != nil {
+			log.WithError(err).Error("invalid dashboard url, pool telemetry disabled")
+		} else {
+			s.Reporter = reporter
+		}
+	}
+
 	// Set our callbacks
 	s.Server = NewTCPServer(s.Host)
 	s.Server.onNewClientCallback = s.onNewClient
@@ -102,12 +157,16 @@ func NewMiningServer(config *config.Config, monitor common.IMonitor, grader opr.
 }
 
 func (s *MiningServer) Listen() {
+	s.startTime = time.Now()
+	if s.Reporter != nil {
+		go s.Reporter.Run()
+	}
 	s.Server.Listen()
 }
 
 // ForwardMonitorEvents will forward all the events we get to anyone listening
 func (c *MiningServer) ForwardMonitorEvents() {
-	fLog := log.WithFields(log.Fields{"func": "ForwardMonitorEvents"})
+	fLog := c.log.WithField("func", "ForwardMonitorEvents")
 	alert := c.FactomMonitor.NewListener()
 	gAlerts := c.OPRGrader.GetAlert("evt-forwarder")
 	var last common.MonitorEvent
@@ -120,13 +179,16 @@ func (c *MiningServer) ForwardMonitorEvents() {
 			last = fds
 
 			c.clientsLock.Lock()
-			for _, c := range c.clients {
-				err := c.SendNetworkCommand(m)
+			for _, client := range c.clients {
+				err := client.SendNetworkCommand(m)
 				if err != nil {
-					fLog.WithField("evt", "factom").WithError(err).Error("failed to send")
+					client.Log().WithField("evt", "factom").WithError(err).Error("failed to send")
 				}
 			}
 			c.clientsLock.Unlock()
+			if c.Reporter != nil {
+				c.Reporter.PushBlock(fds.Dbht, int64(fds.Minute))
+			}
 			fLog.WithFields(log.Fields{
 				"height": fds.Dbht,
 				"minute": fds.Minute,
@@ -144,15 +206,18 @@ func (c *MiningServer) ForwardMonitorEvents() {
 			m.Data = *oprobject
 
 			c.clientsLock.Lock()
-			for _, c := range c.clients {
-				err := c.SendNetworkCommand(m)
+			for _, client := range c.clients {
+				err := client.SendNetworkCommand(m)
 				if err != nil {
-					fLog.WithField("evt", "opr").WithError(err).Error("failed to send")
+					client.Log().WithField("evt", "opr").WithError(err).Error("failed to send")
 				}
 			}
 			c.clientsLock.Unlock()
+			if c.Reporter != nil {
+				c.Reporter.PushPending(m.Data)
+			}
 
-			fLog.WithFields(c.Fields()).Info("sent opr to miners")
+			fLog.WithField("clients", atomic.LoadInt32(&c.clientCount)).Info("sent opr to miners")
 
 		}
 	}
@@ -164,23 +229,32 @@ func (n *MiningServer) onNewMessage(c *TCPClient, message *NetworkMessage) {
 	case AddTag:
 		b, ok := message.Data.(Tag)
 		if !ok {
-			log.WithFields(n.Fields()).Errorf("client did not send a proper tag")
+			c.Log().Error("client did not send a proper tag")
 			return
 		}
 
 		c.tagLock.Lock()
 		c.tags[b.Key] = b.Value
+		c.refreshLog()
 		c.tagLock.Unlock()
 	case Pong:
+		n.pingLock.Lock()
+		sent, ok := n.pingSent[c.id]
+		delete(n.pingSent, c.id)
+		n.pingLock.Unlock()
+
+		if ok && n.Reporter != nil {
+			n.Reporter.PushLatency(time.Since(sent))
+		}
 	case Ping:
 		err := c.SendNetworkCommand(&NetworkMessage{NetworkCommand: Pong})
 		if err != nil {
-			log.WithFields(n.Fields()).WithError(err).Errorf("failed to pong")
+			c.Log().WithError(err).Error("failed to pong")
 		}
 	case FactomEntry: // They want us to write an entry
 		b, ok := message.Data.(GobbedEntry)
 		if !ok {
-			log.WithFields(n.Fields()).Errorf("client did not send a proper entry")
+			c.Log().Error("client did not send a proper entry")
 			return
 		}
 
@@ -196,15 +270,15 @@ func (n *MiningServer) onNewMessage(c *TCPClient, message *NetworkMessage) {
 		go func() {
 			err := n.WriteEntry(e)
 			if err != nil {
-				log.WithFields(n.Fields()).WithError(err).Errorf("failed to submit entry from client")
+				c.Log().WithError(err).Error("failed to submit entry from client")
 			} else {
-				log.WithFields(n.Fields()).WithField("client", c.id).Debugf("submitted entry %x", e.Hash())
+				c.Log().Debugf("submitted entry %x", e.Hash())
 			}
 		}()
 	case MiningStatistics:
 		g, ok := message.Data.(mining.GroupMinerStats)
 		if !ok {
-			log.WithFields(n.Fields()).Errorf("client did not send a proper entry")
+			c.Log().Error("client did not send a proper entry")
 			return
 		}
 
@@ -218,33 +292,101 @@ func (n *MiningServer) onNewMessage(c *TCPClient, message *NetworkMessage) {
 		}
 		c.tagLock.Unlock()
 
+		n.statsLock.Lock()
+		n.latestGroupStats[c.id] = g
+		n.statsLock.Unlock()
+
 		n.Stats.MiningStatsChannel <- &g
 	default:
-		log.WithFields(n.Fields()).WithField("cmd", message.NetworkCommand).Warn("command not recognized from client")
+		c.Log().WithField("cmd", message.NetworkCommand).Warn("command not recognized from client")
 	}
 }
 
 func (s *MiningServer) onClientConnectionClosed(c *TCPClient, err error) {
 	s.clientsLock.Lock()
-	defer s.clientsLock.Unlock()
-
 	delete(s.clients, c.id)
-	log.WithFields(s.Fields()).Info("Client disconnected")
+	s.clientsLock.Unlock()
+	atomic.AddInt32(&s.clientCount, -1)
+
+	s.statsLock.Lock()
+	delete(s.latestGroupStats, c.id)
+	s.statsLock.Unlock()
+
+	s.pingLock.Lock()
+	delete(s.pingSent, c.id)
+	s.pingLock.Unlock()
+
+	c.Log().WithError(err).Info("client disconnected")
 }
 
 func (s *MiningServer) onNewClient(c *TCPClient) {
 	s.clientsLock.Lock()
-	defer s.clientsLock.Unlock()
-
 	s.clients[c.id] = c
-	log.WithFields(s.Fields()).WithField("id", c.id).Info("Client connected")
+	s.clientsLock.Unlock()
+	atomic.AddInt32(&s.clientCount, 1)
+
+	c.Log().Info("client connected")
+
+	s.pingLock.Lock()
+	s.pingSent[c.id] = time.Now()
+	s.pingLock.Unlock()
 
 	err := c.SendNetworkCommand(&NetworkMessage{NetworkCommand: Ping})
 	if err != nil {
-		log.WithFields(s.Fields()).WithError(err).WithField("func", "onNewClient").Error("ping failed")
+		c.Log().WithError(err).WithField("func", "onNewClient").Error("ping failed")
 	}
 }
 
+// statsSnapshot builds the StatsSnapshot pushed to the pool telemetry
+// dashboard. It is passed to poolstats.NewReporter as a StatsProvider.
+func (s *MiningServer) statsSnapshot() poolstats.StatsSnapshot {
+	connected := int(atomic.LoadInt32(&s.clientCount))
+
+	s.statsLock.Lock()
+	var hashrate float64
+	for _, g := range s.latestGroupStats {
+		hashrate += g.HashRate
+	}
+	active := len(s.latestGroupStats)
+	s.statsLock.Unlock()
+
+	var ecBalance uint64
+	if bal, err := factom.GetECBalance(s.EC.String()); err == nil {
+		ecBalance = uint64(bal)
+	}
+
+	return poolstats.StatsSnapshot{
+		ActiveMiners:    active,
+		ConnectedMiners: connected,
+		Hashrate:        hashrate,
+		ECBalance:       ecBalance,
+		Uptime:          time.Since(s.startTime),
+		Miners:          s.minerSnapshots(),
+	}
+}
+
+// minerSnapshots builds a poolstats.MinerSnapshot per connected client.
+func (s *MiningServer) minerSnapshots() []poolstats.MinerSnapshot {
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+
+	miners := make([]poolstats.MinerSnapshot, 0, len(s.clients))
+	for _, client := range s.clients {
+		client.tagLock.Lock()
+		tags := make(map[string]string, len(client.tags))
+		for k, v := range client.tags {
+			tags[k] = v
+		}
+		client.tagLock.Unlock()
+
+		miners = append(miners, poolstats.MinerSnapshot{
+			ID:   fmt.Sprintf("Net-%d", client.id),
+			Tags: tags,
+		})
+	}
+	return miners
+}
+
 func (s *MiningServer) WriteEntry(entry *factom.Entry) error {
 	operation := func() error {
 		_, err1 := factom.CommitEntry(entry, s.EC)
@@ -259,8 +401,3 @@ func (s *MiningServer) WriteEntry(entry *factom.Entry) error {
 	err := backoff.Retry(operation, common.PegExponentialBackOff())
 	return err
 }
-
-func (s *MiningServer) Fields() log.Fields {
-	// TODO: Is this threadsafe?
-	return log.Fields{"clients": len(s.clients)}
-}
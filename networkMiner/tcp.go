@@ -0,0 +1,174 @@
+package networkMiner
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tagValueTruncateLen is the longest a tag value TerminalString will print
+// before truncating it.
+const tagValueTruncateLen = 32
+
+// Tags is the set of key/value tags a TCPClient has reported via AddTag
+// messages (e.g. rig name).
+type Tags map[string]string
+
+// TerminalString renders the tags sorted by key, with long values truncated.
+func (t Tags) TerminalString() string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := t[k]
+		if len(v) > tagValueTruncateLen {
+			v = v[:tagValueTruncateLen] + "..."
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", k, v))
+	}
+	return strings.Join(parts, " ")
+}
+
+// NetworkMessage is the envelope gob-encoded between the MiningServer and
+// its TCPClients.
+type NetworkMessage struct {
+	NetworkCommand int
+	Data           interface{}
+}
+
+// TCPServer is a minimal callback-driven TCP server: it accepts
+// connections, decodes gob-framed NetworkMessages off each one, and
+// dispatches them to the registered callbacks.
+type TCPServer struct {
+	host string
+
+	onNewClientCallback      func(c *TCPClient)
+	onNewMessage             func(c *TCPClient, message *NetworkMessage)
+	onClientConnectionClosed func(c *TCPClient, err error)
+
+	nextID int32
+}
+
+// NewTCPServer constructs a TCPServer listening on host. Callbacks must be
+// set before Listen is called.
+func NewTCPServer(host string) *TCPServer {
+	return &TCPServer{host: host}
+}
+
+// Listen accepts connections on s.host until the process exits, spawning a
+// goroutine per client.
+func (s *TCPServer) Listen() {
+	l, err := net.Listen("tcp", s.host)
+	if err != nil {
+		log.WithError(err).WithField("host", s.host).Fatal("failed to start mining tcp server")
+	}
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.WithError(err).Warn("failed to accept mining client")
+			continue
+		}
+
+		id := int(atomic.AddInt32(&s.nextID, 1))
+		client := newTCPClient(id, conn, s)
+		go client.listen()
+	}
+}
+
+// TCPClient represents a single connected miner.
+type TCPClient struct {
+	id     int
+	conn   net.Conn
+	server *TCPServer
+
+	enc *gob.Encoder
+	dec *gob.Decoder
+
+	sendLock sync.Mutex
+
+	tagLock sync.Mutex
+	tags    Tags
+
+	// log is bound once at connect time with this client's id and remote
+	// address, and rebound whenever its tags change. It's read from
+	// ForwardMonitorEvents on a different goroutine than the one that
+	// mutates it (onNewMessage), so it's held behind an atomic.Pointer
+	// rather than a plain field.
+	log atomic.Pointer[log.Entry]
+}
+
+func newTCPClient(id int, conn net.Conn, server *TCPServer) *TCPClient {
+	c := &TCPClient{
+		id:     id,
+		conn:   conn,
+		server: server,
+		enc:    gob.NewEncoder(conn),
+		dec:    gob.NewDecoder(conn),
+		tags:   make(Tags),
+	}
+	c.log.Store(log.WithFields(log.Fields{"id": c.id, "remote": conn.RemoteAddr().String()}))
+
+	if server.onNewClientCallback != nil {
+		server.onNewClientCallback(c)
+	}
+	return c
+}
+
+// Log returns the client's current bound log entry. Safe for concurrent use
+// with refreshLog.
+func (c *TCPClient) Log() *log.Entry {
+	return c.log.Load()
+}
+
+// refreshLog rebinds c.log with the current tag snapshot. Callers must hold
+// c.tagLock.
+func (c *TCPClient) refreshLog() {
+	c.log.Store(log.WithFields(log.Fields{
+		"id":     c.id,
+		"remote": c.conn.RemoteAddr().String(),
+		"tags":   c.tags.TerminalString(),
+	}))
+}
+
+func (c *TCPClient) listen() {
+	var err error
+	defer func() {
+		if server := c.server; server.onClientConnectionClosed != nil {
+			server.onClientConnectionClosed(c, err)
+		}
+		c.conn.Close()
+	}()
+
+	for {
+		msg := new(NetworkMessage)
+		if err = c.dec.Decode(msg); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		if c.server.onNewMessage != nil {
+			c.server.onNewMessage(c, msg)
+		}
+	}
+}
+
+// SendNetworkCommand gob-encodes and writes m to the client.
+func (c *TCPClient) SendNetworkCommand(m *NetworkMessage) error {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	return c.enc.Encode(m)
+}